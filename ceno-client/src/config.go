@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+)
+
+// ccConfigPath is where the CC's own configuration file lives; it's the
+// same file ERR_NO_CONFIG's recovery job re-downloads when it goes missing.
+var ccConfigPath = path.Join(".", "config", "configuration.json")
+
+// ReporterConfig selects and configures the Reporter backend for error
+// telemetry. Backend is one of "http", "file", or "none"/"" to disable
+// telemetry entirely.
+type ReporterConfig struct {
+	Backend string `json:"backend"`
+	URL     string `json:"url"`
+	LogPath string `json:"logPath"`
+}
+
+// CCConfig is the subset of the CC's configuration file this package cares
+// about.
+type CCConfig struct {
+	Reporter ReporterConfig `json:"reporter"`
+}
+
+// loadCCConfig reads and parses the CC's configuration file.
+func loadCCConfig() (CCConfig, error) {
+	data, err := ioutil.ReadFile(ccConfigPath)
+	if err != nil {
+		return CCConfig{}, err
+	}
+	var config CCConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return CCConfig{}, err
+	}
+	return config, nil
+}
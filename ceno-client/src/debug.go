@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"runtime"
+)
+
+// How many frames of a call stack CaptureStack will walk before giving up.
+const stackCaptureDepth = 32
+
+// StackFrame is one frame of a captured Go call stack, kept minimal enough
+// to be useful on an error page or in a JSON error report.
+type StackFrame struct {
+	File     string
+	Line     int
+	Function string
+}
+
+// debugEnabled reports whether the CC should capture and display extra
+// diagnostic information such as call stacks. True when the binary is built
+// with `-tags debug`, or at runtime via CENO_DEBUG=1, so a production build
+// doesn't pay the cost of stack capture unless it's asked to.
+func debugEnabled() bool {
+	return debugBuildTag || os.Getenv("CENO_DEBUG") == "1"
+}
+
+// skippedStackFrames are function names that never belong in a captured
+// stack because they're part of the error-handling machinery itself, not
+// the code that raised the error.
+var skippedStackFrames = map[string]bool{
+	"main.captureDebugStack": true,
+	"main.HandleCCError":     true,
+	"main.HandleLCSError":    true,
+}
+
+// CaptureStack walks the calling goroutine's stack and returns it as a
+// slice of StackFrame, skipping CaptureStack itself and the
+// captureDebugStack/HandleCCError/HandleLCSError frames that call it so the
+// stack starts at the code that actually raised the error.
+func CaptureStack() []StackFrame {
+	pc := make([]uintptr, stackCaptureDepth)
+	n := runtime.Callers(2, pc)
+	if n == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(pc[:n])
+	stack := make([]StackFrame, 0, n)
+	for {
+		frame, more := frames.Next()
+		if !skippedStackFrames[frame.Function] {
+			stack = append(stack, StackFrame{
+				File:     frame.File,
+				Line:     frame.Line,
+				Function: frame.Function,
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
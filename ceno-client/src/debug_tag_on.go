@@ -0,0 +1,7 @@
+//go:build debug
+// +build debug
+
+package main
+
+// debugBuildTag is true when the CC is built with `-tags debug`.
+const debugBuildTag = true
@@ -3,12 +3,14 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/nicksnyder/go-i18n/i18n"
 	"html/template"
 	"net/http"
-	"os"
 	"path"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // CC errors
@@ -47,6 +49,19 @@ type ErrorCode uint32
 type ErrorState map[string]interface{}
 type ErrorHandler func(ErrorState) bool
 
+// ErrorEnvelope is the single source of truth for the data shown on an error
+// page, whichever renderer (HTML, JSON, or plain text) ends up producing the
+// response. The JSON tags define the stable, documented wire format returned
+// to programmatic consumers of the CC (e.g. mobile clients, the LCS bridge).
+type ErrorEnvelope struct {
+	ErrorCode     ErrorCode    `json:"errorCode"`
+	Error         string       `json:"error"`
+	Advice        string       `json:"advice"`
+	ShouldRefresh bool         `json:"shouldRefresh"`
+	Url           string       `json:"url"`
+	Stack         []StackFrame `json:"stack,omitempty"`
+}
+
 /******************************************************************************************
  ************************************ PRIVATE VALUES **************************************
  ******************************************************************************************/
@@ -105,21 +120,6 @@ var lcsErrorHandlers = map[ErrorCode]func(ErrorState) bool{
 	ERR_LCS_WAIT_PEERS:     showPeerMonitorAndServeError,
 }
 
-// Some errors will resolve themselves over time, and so the error page should,
-// depending on the error being served, automatically refresh itself the same way
-// that wait.html does.
-var AutoRefreshingErrorPages = map[ErrorCode]bool{
-	ERR_NO_FEEDS_FILE:          true,
-	ERR_NO_ARTICLES_FILE:       true,
-	ERR_NO_CONNECT_LCS:         true,
-	ERR_MALFORMED_LCS_RESPONSE: true,
-	ERR_FROM_LCS:               true,
-	ERR_NO_CONNECT_RS:          true,
-	ERR_LCS_LOOKUP_FAILURE:     true,
-	ERR_LCS_INTERNAL:           true,
-	ERR_LCS_WAIT_FREENET:       true,
-}
-
 /********************
  ** ERROR HANDLERS **
  ********************/
@@ -130,19 +130,31 @@ var AutoRefreshingErrorPages = map[ErrorCode]bool{
  * @return true if the error page was served successfully
  */
 func serveError(state ErrorState) bool {
-	w := state["responseWriter"].(http.ResponseWriter)
-	r := state["request"].(*http.Request)
-	errMsg := state["errMsg"].(string)
-	errCode := state["errCode"].(ErrorCode)
-	ExecuteErrorPage(errCode, errMsg, w, r)
+	ExecuteErrorPage(state)
 	return true
 }
 
-// We have a number of placeholder functions that could be expanded on to have the CC
-// respond to certain kinds of errors by doing useful things in the background after
-// simply serving an error page.
-// Due to time constraints, we haven't implemented any of these.  No critical functionality
-// depends on them.
+/**
+ * Serve the standard error page, but note in it that a RecoveryManager job
+ * is already fetching the asset this error is about, so the user isn't left
+ * wondering why the page is about to auto-refresh.
+ * @param {ErrorState} state - Must contain HTTP request and response objects and error message
+ * @param {ErrorCode} errCode - The error code whose recovery job's status should be reported
+ * @return true if the error page was served successfully
+ */
+func serveRecoveringError(state ErrorState, errCode ErrorCode) bool {
+	if status := defaultRecoveryManager.Status(errCode); status == RecoveryPending || status == RecoveryInProgress {
+		locale := "en-us"
+		if r, ok := state["request"].(*http.Request); ok && r != nil {
+			locale = NegotiateLocale(r)
+		}
+		T, _ := i18n.Tfunc(locale, "en-us")
+		errMsg, _ := state["errMsg"].(string)
+		state["errMsg"] = errMsg + " " + T("recovery_in_progress_err")
+	}
+	ExecuteErrorPage(state)
+	return true
+}
 
 /**
  * Download the default configuration file package, validate, and apply before serving an error page
@@ -150,8 +162,8 @@ func serveError(state ErrorState) bool {
  * @return true if the error page is served successfully and other background tasks completed okay
  */
 func downloadConfigAndServeError(state ErrorState) bool {
-	// temporary
-	return serveError(state)
+	defaultRecoveryManager.Enqueue(ERR_NO_CONFIG)
+	return serveRecoveringError(state, ERR_NO_CONFIG)
 }
 
 /**
@@ -160,8 +172,8 @@ func downloadConfigAndServeError(state ErrorState) bool {
  * @return true if the error page is served successfully and other background tasks completed okay
  */
 func downloadFeedsFileAndServeError(state ErrorState) bool {
-	// temporary
-	return serveError(state)
+	defaultRecoveryManager.Enqueue(ERR_NO_FEEDS_FILE)
+	return serveRecoveringError(state, ERR_NO_FEEDS_FILE)
 }
 
 /**
@@ -170,8 +182,8 @@ func downloadFeedsFileAndServeError(state ErrorState) bool {
  * @return true if the error page is served successfully and other background tasks completed okay
  */
 func downloadArticlesFileAndServeError(state ErrorState) bool {
-	// temporary
-	return serveError(state)
+	defaultRecoveryManager.Enqueue(ERR_NO_ARTICLES_FILE)
+	return serveRecoveringError(state, ERR_NO_ARTICLES_FILE)
 }
 
 /**
@@ -185,32 +197,39 @@ func handleLCSErrorReport(state ErrorState) bool {
 }
 
 /**
- * Download the default configuration file package, validate, and apply before serving an error page
+ * Download and extract the views bundle and serve an error saying this is happening.
+ * Enqueue is a no-op once ERR_MISSING_VIEW has already recovered successfully, so an
+ * auto-refreshing page that keeps re-requesting a still-missing view doesn't restart
+ * the download on every refresh.
  * @param {ErrorState} state - Must contain HTTP request and response objects and error message
  * @return true if the error page is served successfully and other background tasks completed okay
  */
 func downloadViewsAndServeError(state ErrorState) bool {
-	// temporary
-	return serveError(state)
+	defaultRecoveryManager.Enqueue(ERR_MISSING_VIEW)
+	return serveRecoveringError(state, ERR_MISSING_VIEW)
 }
 
 /**
- * Download the default configuration file package, validate, and apply before serving an error page
+ * Serve the wait page while the LCS reports it's still waiting on Freenet to become
+ * ready. This isn't a RecoveryManager concern: there's no missing asset to fetch, just
+ * an external system the LCS is polling, so the page's own auto-refresh (driven by
+ * errorRegistry's Retryable flag) is what eventually picks up the resolved state.
  * @param {ErrorState} state - Must contain HTTP request and response objects and error message
- * @return true if the error page is served successfully and other background tasks completed okay
+ * @return true if the error page is served successfully
  */
 func showFreenetMonitorAndServeError(state ErrorState) bool {
-	// temporary
 	return serveError(state)
 }
 
 /**
- * Download the default configuration file package, validate, and apply before serving an error page
+ * Serve the wait page while the LCS reports it's still waiting on peers to become
+ * available. This isn't a RecoveryManager concern: there's no missing asset to fetch,
+ * just an external system the LCS is polling, so the page's own auto-refresh (driven by
+ * errorRegistry's Retryable flag) is what eventually picks up the resolved state.
  * @param {ErrorState} state - Must contain HTTP request and response objects and error message
- * @return true if the error page is served successfully and other background tasks completed okay
+ * @return true if the error page is served successfully
  */
 func showPeerMonitorAndServeError(state ErrorState) bool {
-	// temporary
 	return serveError(state)
 }
 
@@ -232,6 +251,8 @@ func HandleCCError(errCode ErrorCode, errMsg string, state ErrorState) bool {
 	if _, hasErrorMsg := state["errMsg"]; !hasErrorMsg {
 		state["errMsg"] = errMsg
 	}
+	reportError(errCode, errMsg, state)
+	captureDebugStack(state)
 	return ccErrorHandlers[errCode](state)
 }
 
@@ -249,9 +270,54 @@ func HandleLCSError(errCode ErrorCode, errMsg string, state ErrorState) bool {
 	if _, hasErrorMsg := state["errMsg"]; !hasErrorMsg {
 		state["errMsg"] = errMsg
 	}
+	reportError(errCode, errMsg, state)
+	captureDebugStack(state)
 	return lcsErrorHandlers[errCode](state)
 }
 
+/**
+ * Record where an error was raised under the well-known "stack" key of
+ * state, but only when running with debug diagnostics enabled so that
+ * production builds never pay for call stack capture.
+ * @param {ErrorState} state - State information about the program at the time the error was returned
+ */
+func captureDebugStack(state ErrorState) {
+	if !debugEnabled() {
+		return
+	}
+	if _, hasStack := state["stack"]; !hasStack {
+		state["stack"] = CaptureStack()
+	}
+}
+
+/**
+ * Push a structured telemetry event for an error onto the configured
+ * Reporter. A correlation id is generated once per request and stashed in
+ * state so that later calls (e.g. a background handler reporting its own
+ * outcome) can be tied back to the same originating request.
+ * @param {ErrorCode} errCode - The error code identifying the error that occurred
+ * @param {string} errMsg - The message to report alongside the error
+ * @param {ErrorState} state - State information about the program at the time the error was returned
+ */
+func reportError(errCode ErrorCode, errMsg string, state ErrorState) {
+	requestURL := ""
+	if r, ok := state["request"].(*http.Request); ok && r != nil {
+		requestURL = r.URL.String()
+	}
+	correlationID, _ := state["correlationId"].(string)
+	if correlationID == "" {
+		correlationID = newCorrelationID()
+		state["correlationId"] = correlationID
+	}
+	defaultReporter.Report(ReportEvent{
+		Timestamp:     time.Now(),
+		ErrorCode:     errCode,
+		Message:       errMsg,
+		RequestURL:    requestURL,
+		CorrelationID: correlationID,
+	})
+}
+
 /**
  * Report that an error occurred trying to decode the response from the LCS.
  * @param {ErrorState} state - Must contain error message to send and the URL to send the request to
@@ -274,56 +340,164 @@ func ReportDecodeError(state ErrorState) bool {
 }
 
 /**
- * Execute the error template or produce a helpful plaintext response to explain
- * the error and provide pre-composed advice.
- * @param {ErrorCode} errorCode - The code number identifying the error that occurred
- * @param {string} errorMsg - A message to go along with the error report
+ * Inspect the Accept header of an incoming request and decide which of the
+ * renderers supported by ExecuteErrorPage should handle the response.
+ * Defaults to "text/html" when no Accept header is present, since that's
+ * what a plain browser navigation looks like, and falls back to
+ * "text/plain" for anything else we don't recognize.
+ * @param {*Request} r - The request being served an error page
+ * @return the negotiated content type: "text/html", "application/json", or "text/plain"
+ */
+func negotiateErrorContentType(r *http.Request) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return "text/html"
+	}
+	for _, part := range strings.Split(accept, ",") {
+		switch strings.TrimSpace(strings.SplitN(part, ";", 2)[0]) {
+		case "application/json":
+			return "application/json"
+		case "text/html", "*/*":
+			return "text/html"
+		case "text/plain":
+			return "text/plain"
+		}
+	}
+	return "text/plain"
+}
+
+/**
+ * Render the error template for a browser client, falling back to a plain
+ * text explanation if the template itself can't be found.
+ * @param {ErrorEnvelope} envelope - The data to show on the error page
+ * @param {i18n.TranslateFunc} T - The translation function for the negotiated locale
  * @param {ResponseWriter} w - The object handling responding to the client
- * @param {*Request} r - Information about the request
  */
-func ExecuteErrorPage(errorCode ErrorCode, errorMsg string, w http.ResponseWriter, r *http.Request) {
-	T, _ := i18n.Tfunc(os.Getenv("CENOLANG"), "en-us")
+func writeHTMLErrorPage(envelope ErrorEnvelope, httpStatus int, T i18n.TranslateFunc, w http.ResponseWriter) {
 	t, err := template.ParseFiles(path.Join(".", "views", "error.html"))
-	advice, foundErr := errorAdvice[errorCode]
-	if !foundErr {
-		errMsg := T("unrecognized_error_code", map[string]interface{}{"ErrCode": errorCode})
-		ExecuteErrorPage(ERR_INVALID_ERROR, errMsg, w, r)
-	} else if err != nil {
+	if err != nil {
 		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(httpStatus)
 		w.Write([]byte(T("missing_view", map[string]interface{}{"View": "error.html"})))
-	} else {
-		shouldRefresh := AutoRefreshingErrorPages[errorCode]
-		t.Execute(w, map[string]string{
-			"Url":              r.URL.String(),
-			"Error":            errorMsg,
-			"ShouldRefresh":    strconv.FormatBool(shouldRefresh),
-			"Advice":           T(advice),
-			"NoBundlePrepared": T("no_bundle_prepared_html"),
-			"YouAskedFor":      T("you_asked_for_html"),
-			"ErrorWeGot":       T("error_we_got_html"),
-			"WhatYouCanDo":     T("what_you_can_do_html"),
-			"Retry":            T("retry_html"),
-			"Report":           T("report_html"),
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(httpStatus)
+	// "Stack" is only non-empty in a debug build or with CENO_DEBUG=1; the
+	// template is expected to render it inside a collapsible block when present.
+	t.Execute(w, map[string]string{
+		"Url":              envelope.Url,
+		"Error":            envelope.Error,
+		"ShouldRefresh":    strconv.FormatBool(envelope.ShouldRefresh),
+		"Advice":           envelope.Advice,
+		"NoBundlePrepared": T("no_bundle_prepared_html"),
+		"YouAskedFor":      T("you_asked_for_html"),
+		"ErrorWeGot":       T("error_we_got_html"),
+		"WhatYouCanDo":     T("what_you_can_do_html"),
+		"Retry":            T("retry_html"),
+		"Report":           T("report_html"),
+		"Stack":            formatStack(envelope.Stack),
+	})
+}
+
+// formatStack renders a captured call stack as plain, template-friendly text.
+func formatStack(stack []StackFrame) string {
+	if len(stack) == 0 {
+		return ""
+	}
+	lines := make([]string, len(stack))
+	for i, frame := range stack {
+		lines[i] = fmt.Sprintf("%s\n\t%s:%d", frame.Function, frame.File, frame.Line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+/**
+ * Render the error as a JSON body for programmatic consumers of the CC.
+ * @param {ErrorEnvelope} envelope - The data to show on the error page
+ * @param {ResponseWriter} w - The object handling responding to the client
+ */
+func writeJSONErrorPage(envelope ErrorEnvelope, httpStatus int, w http.ResponseWriter) {
+	marshalled, err := json.Marshal(envelope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	w.Write(marshalled)
+}
+
+/**
+ * Render the error as a short plain text message.
+ * @param {ErrorEnvelope} envelope - The data to show on the error page
+ * @param {ResponseWriter} w - The object handling responding to the client
+ */
+func writePlainTextErrorPage(envelope ErrorEnvelope, httpStatus int, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(httpStatus)
+	w.Write([]byte(envelope.Error + "\n" + envelope.Advice + "\n"))
+}
+
+/**
+ * Execute the error template or produce a helpful plaintext/JSON response to
+ * explain the error and provide pre-composed advice, negotiated against the
+ * Accept header of the request.
+ * @param {ErrorState} state - Must contain the HTTP request/response objects, error code, and error message
+ */
+func ExecuteErrorPage(state ErrorState) {
+	w := state["responseWriter"].(http.ResponseWriter)
+	r := state["request"].(*http.Request)
+	errorCode := state["errCode"].(ErrorCode)
+	errorMsg := state["errMsg"].(string)
+	T, _ := i18n.Tfunc(NegotiateLocale(r), "en-us")
+	advice, foundErr := errorAdvice[errorCode]
+	if !foundErr {
+		ExecuteErrorPage(ErrorState{
+			"responseWriter": w,
+			"request":        r,
+			"errCode":        ERR_INVALID_ERROR,
+			"errMsg":         T("unrecognized_error_code", map[string]interface{}{"ErrCode": errorCode}),
 		})
+		return
+	}
+	entry := errorRegistryEntryFor(errorCode)
+	envelope := ErrorEnvelope{
+		ErrorCode:     errorCode,
+		Error:         errorMsg,
+		Advice:        T(advice),
+		ShouldRefresh: entry.Retryable,
+		Url:           r.URL.String(),
+	}
+	if debugEnabled() {
+		if stack, ok := state["stack"].([]StackFrame); ok {
+			envelope.Stack = stack
+		}
+	}
+	switch negotiateErrorContentType(r) {
+	case "application/json":
+		writeJSONErrorPage(envelope, entry.HTTPStatus, w)
+	case "text/plain":
+		writePlainTextErrorPage(envelope, entry.HTTPStatus, w)
+	default:
+		writeHTMLErrorPage(envelope, entry.HTTPStatus, T, w)
 	}
 }
 
 /**
  * Determine whether an error code is one internal to the CC.
- * This is the case when it is of the form 1XXX.
  * @param {ErrorCode} errorCode - The code number identifying the error.
  * @return true if the error code provided belongs to the CC, else false
  */
 func IsClientError(errorCode ErrorCode) bool {
-	return errorCode/1000 == 1
+	return errorRegistryEntryFor(errorCode).Origin == OriginCC
 }
 
 /**
  * Determine whether an error code is one sent from the LCS.
- * This is the case when it is of the form 2YYYY.
  * @param {ErrorCode} errorCode - The code number identifying the error.
  * @return true if the error code provided belongs to the LCS, else false
  */
 func IsCacheServerError(errorCode ErrorCode) bool {
-	return errorCode/1000 == 2
+	return errorRegistryEntryFor(errorCode).Origin == OriginLCS
 }
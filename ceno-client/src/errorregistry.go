@@ -0,0 +1,91 @@
+package main
+
+import "net/http"
+
+// ErrorClass describes, in broad strokes, what kind of problem an ErrorCode
+// represents, independent of which component (CC, LCS, or RS) raised it.
+type ErrorClass int
+
+const (
+	ClassNotFound ErrorClass = iota
+	ClassMalformedRequest
+	ClassBackendUnavailable
+	ClassBackendNotReady
+	ClassInternal
+	ClassDataCorrupt
+)
+
+// ErrorOrigin identifies which component is responsible for an ErrorCode.
+type ErrorOrigin int
+
+const (
+	OriginCC ErrorOrigin = iota
+	OriginLCS
+	OriginRS
+)
+
+// errorRegistryEntry is everything the CC needs to know about an ErrorCode
+// beyond its localizable advice: how to classify it, what HTTP status to
+// answer with, who raised it, and whether trying again later might help.
+type errorRegistryEntry struct {
+	Class      ErrorClass
+	HTTPStatus int
+	Origin     ErrorOrigin
+	Retryable  bool
+}
+
+// errorRegistry is the single table driving error classification, HTTP
+// status codes, and retryability. Numeric ErrorCode values themselves are
+// kept stable for wire compatibility with the LCS; this table is what
+// changes as our understanding of how to react to each one evolves.
+// ERR_NO_CONFIG, ERR_MISSING_VIEW, ERR_NO_FEEDS_FILE, and ERR_NO_ARTICLES_FILE
+// are Retryable because the RecoveryManager is actively fetching the asset
+// they're missing in the background; their pages must auto-refresh so the
+// recovered asset actually gets picked up, rather than telling a user
+// "recovery in progress" on a page that never refreshes.
+var errorRegistry = map[ErrorCode]errorRegistryEntry{
+	ERR_NO_CONFIG:              {ClassInternal, http.StatusInternalServerError, OriginCC, true},
+	ERR_MALFORMED_URL:          {ClassMalformedRequest, http.StatusBadRequest, OriginCC, false},
+	ERR_MISSING_VIEW:           {ClassNotFound, http.StatusNotFound, OriginCC, true},
+	ERR_NO_FEEDS_FILE:          {ClassNotFound, http.StatusNotFound, OriginCC, true},
+	ERR_NO_ARTICLES_FILE:       {ClassNotFound, http.StatusNotFound, OriginCC, true},
+	ERR_CORRUPT_JSON:           {ClassDataCorrupt, http.StatusInternalServerError, OriginCC, false},
+	ERR_MALFORMED_STATUS_CHECK: {ClassMalformedRequest, http.StatusBadRequest, OriginCC, false},
+	ERR_NO_CONNECT_LCS:         {ClassBackendUnavailable, http.StatusServiceUnavailable, OriginCC, true},
+	ERR_MALFORMED_LCS_RESPONSE: {ClassBackendUnavailable, http.StatusBadGateway, OriginCC, true},
+	ERR_FROM_LCS:               {ClassBackendUnavailable, http.StatusBadGateway, OriginCC, true},
+	ERR_NO_CONNECT_RS:          {ClassBackendUnavailable, http.StatusServiceUnavailable, OriginCC, true},
+	ERR_LCS_NOT_READY:          {ClassBackendNotReady, http.StatusServiceUnavailable, OriginCC, true},
+	ERR_INVALID_ERROR:          {ClassInternal, http.StatusInternalServerError, OriginCC, false},
+
+	ERR_LCS_MALFORMED_URL:  {ClassMalformedRequest, http.StatusBadRequest, OriginLCS, false},
+	ERR_LCS_URL_DECODE:     {ClassMalformedRequest, http.StatusBadRequest, OriginLCS, false},
+	ERR_LCS_WILL_NOT_SERVE: {ClassMalformedRequest, http.StatusForbidden, OriginLCS, false},
+	ERR_LCS_LOOKUP_FAILURE: {ClassBackendUnavailable, http.StatusBadGateway, OriginLCS, true},
+	ERR_LCS_INTERNAL:       {ClassInternal, http.StatusInternalServerError, OriginLCS, true},
+	ERR_LCS_WAIT_FREENET:   {ClassBackendNotReady, http.StatusServiceUnavailable, OriginLCS, true},
+	ERR_LCS_WAIT_PEERS:     {ClassBackendNotReady, http.StatusServiceUnavailable, OriginLCS, true},
+}
+
+// errorRegistryEntryFor looks up errCode's registry entry, falling back to
+// the entry for ERR_INVALID_ERROR for any code the table doesn't know about.
+func errorRegistryEntryFor(errCode ErrorCode) errorRegistryEntry {
+	if entry, ok := errorRegistry[errCode]; ok {
+		return entry
+	}
+	return errorRegistry[ERR_INVALID_ERROR]
+}
+
+// AutoRefreshingErrorPages says, for each ErrorCode, whether its error page
+// should auto-refresh itself the same way wait.html does, because the
+// underlying problem may resolve on its own. Derived from Retryable so this
+// never drifts out of sync with the rest of the error's classification.
+var AutoRefreshingErrorPages = buildAutoRefreshingErrorPages()
+
+func buildAutoRefreshingErrorPages() map[ErrorCode]bool {
+	pages := make(map[ErrorCode]bool, len(errorRegistry))
+	for code, entry := range errorRegistry {
+		pages[code] = entry.Retryable
+	}
+	return pages
+}
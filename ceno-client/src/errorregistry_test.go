@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+// allDeclaredErrorCodes lists every ERR_* constant declared in
+// errorhandling.go. Kept in sync by hand; TestErrorRegistryCoversEveryCode
+// is what catches a code added without a matching registry entry.
+var allDeclaredErrorCodes = []ErrorCode{
+	ERR_NO_CONFIG,
+	ERR_MALFORMED_URL,
+	ERR_MISSING_VIEW,
+	ERR_NO_FEEDS_FILE,
+	ERR_NO_ARTICLES_FILE,
+	ERR_CORRUPT_JSON,
+	ERR_MALFORMED_STATUS_CHECK,
+	ERR_NO_CONNECT_LCS,
+	ERR_MALFORMED_LCS_RESPONSE,
+	ERR_FROM_LCS,
+	ERR_NO_CONNECT_RS,
+	ERR_LCS_NOT_READY,
+	ERR_INVALID_ERROR,
+	ERR_LCS_MALFORMED_URL,
+	ERR_LCS_URL_DECODE,
+	ERR_LCS_WILL_NOT_SERVE,
+	ERR_LCS_LOOKUP_FAILURE,
+	ERR_LCS_INTERNAL,
+	ERR_LCS_WAIT_FREENET,
+	ERR_LCS_WAIT_PEERS,
+}
+
+func TestErrorRegistryCoversEveryCode(t *testing.T) {
+	for _, code := range allDeclaredErrorCodes {
+		if _, ok := errorRegistry[code]; !ok {
+			t.Errorf("error code %d has no errorRegistry entry", code)
+		}
+	}
+	if len(errorRegistry) != len(allDeclaredErrorCodes) {
+		t.Errorf("errorRegistry has %d entries but %d error codes are declared; "+
+			"add/remove an entry in allDeclaredErrorCodes or errorRegistry to match",
+			len(errorRegistry), len(allDeclaredErrorCodes))
+	}
+}
+
+func TestIsClientErrorMatchesRegistryOrigin(t *testing.T) {
+	for _, code := range allDeclaredErrorCodes {
+		want := errorRegistry[code].Origin == OriginCC
+		if got := IsClientError(code); got != want {
+			t.Errorf("IsClientError(%d) = %v, want %v (registry Origin = %v)", code, got, want, errorRegistry[code].Origin)
+		}
+	}
+}
+
+func TestIsCacheServerErrorMatchesRegistryOrigin(t *testing.T) {
+	for _, code := range allDeclaredErrorCodes {
+		want := errorRegistry[code].Origin == OriginLCS
+		if got := IsCacheServerError(code); got != want {
+			t.Errorf("IsCacheServerError(%d) = %v, want %v (registry Origin = %v)", code, got, want, errorRegistry[code].Origin)
+		}
+	}
+}
+
+func TestAutoRefreshingErrorPagesMatchesRegistryRetryable(t *testing.T) {
+	for _, code := range allDeclaredErrorCodes {
+		want := errorRegistry[code].Retryable
+		if got := AutoRefreshingErrorPages[code]; got != want {
+			t.Errorf("AutoRefreshingErrorPages[%d] = %v, want %v (registry Retryable = %v)", code, got, want, want)
+		}
+	}
+}
+
+func TestErrorRegistryEntryForFallsBackToInvalidError(t *testing.T) {
+	unknown := ErrorCode(999999)
+	if _, ok := errorRegistry[unknown]; ok {
+		t.Fatalf("test fixture error code %d unexpectedly has a registry entry", unknown)
+	}
+	got := errorRegistryEntryFor(unknown)
+	want := errorRegistry[ERR_INVALID_ERROR]
+	if got != want {
+		t.Errorf("errorRegistryEntryFor(%d) = %+v, want fallback entry %+v", unknown, got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Where go-i18n's translation files live, named e.g. "en-us.all.json".
+// Var rather than const so tests can point it at a fixture directory.
+var translationsDir = "translations"
+
+// localePreference is one entry from a parsed Accept-Language header.
+type localePreference struct {
+	tag     string
+	quality float64
+}
+
+// parseAcceptLanguage parses an Accept-Language header, including quality
+// values, into a list of preferences ordered from most to least preferred.
+func parseAcceptLanguage(header string) []localePreference {
+	var prefs []localePreference
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pieces := strings.SplitN(part, ";", 2)
+		tag := strings.TrimSpace(pieces[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		if len(pieces) == 2 {
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(pieces[1]), "q="), 64); err == nil {
+				quality = q
+			}
+		}
+		prefs = append(prefs, localePreference{tag: tag, quality: quality})
+	}
+	sort.SliceStable(prefs, func(i, j int) bool {
+		return prefs[i].quality > prefs[j].quality
+	})
+	return prefs
+}
+
+// supportedLocales lists the locale tags actually bundled under translationsDir,
+// derived from translation file names like "fr-ca.all.json" -> "fr-ca".
+func supportedLocales() []string {
+	entries, err := ioutil.ReadDir(translationsDir)
+	if err != nil {
+		return nil
+	}
+	locales := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if idx := strings.Index(entry.Name(), "."); idx > 0 {
+			locales = append(locales, entry.Name()[:idx])
+		}
+	}
+	return locales
+}
+
+// matchLocale returns the entry of supported matching tag case-insensitively,
+// or "" if none matches.
+func matchLocale(tag string, supported []string) string {
+	for _, locale := range supported {
+		if strings.EqualFold(locale, tag) {
+			return locale
+		}
+	}
+	return ""
+}
+
+/**
+ * Work out which bundled locale best satisfies a request's Accept-Language
+ * header, so that each user of a CC instance can see error pages (and
+ * anything else that calls this) in their own preferred language rather
+ * than whatever CENOLANG happens to be set to.
+ * @param {*Request} r - The incoming request
+ * @return a locale tag known to be bundled under translations/, falling
+ *         back to CENOLANG and then "en-us"; never an empty string.
+ */
+func NegotiateLocale(r *http.Request) string {
+	supported := supportedLocales()
+	for _, pref := range parseAcceptLanguage(r.Header.Get("Accept-Language")) {
+		if locale := matchLocale(pref.tag, supported); locale != "" {
+			return locale
+		}
+	}
+	if fallback := os.Getenv("CENOLANG"); fallback != "" {
+		return fallback
+	}
+	return "en-us"
+}
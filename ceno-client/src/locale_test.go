@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+// withFixtureTranslations points translationsDir at testdata/translations
+// (which bundles "en-us" and "fr") for the duration of a test.
+func withFixtureTranslations(t *testing.T) {
+	t.Helper()
+	previous := translationsDir
+	translationsDir = "testdata/translations"
+	t.Cleanup(func() { translationsDir = previous })
+}
+
+func requestWithHeaders(t *testing.T, headers map[string]string) *http.Request {
+	t.Helper()
+	r, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	return r
+}
+
+func TestParseAcceptLanguageOrdersByQuality(t *testing.T) {
+	prefs := parseAcceptLanguage("fr-CA,fr;q=0.9,en;q=0.5")
+	want := []string{"fr-CA", "fr", "en"}
+	if len(prefs) != len(want) {
+		t.Fatalf("got %d preferences, want %d: %+v", len(prefs), len(want), prefs)
+	}
+	for i, tag := range want {
+		if prefs[i].tag != tag {
+			t.Errorf("preference %d = %q, want %q", i, prefs[i].tag, tag)
+		}
+	}
+}
+
+func TestNegotiateLocaleFallsPastUnsupportedPreferredTag(t *testing.T) {
+	withFixtureTranslations(t)
+	r := requestWithHeaders(t, map[string]string{"Accept-Language": "fr-CA,fr;q=0.9,en;q=0.5"})
+
+	got := NegotiateLocale(r)
+	if got != "fr" {
+		t.Errorf("NegotiateLocale = %q, want %q (fr-CA isn't bundled, fr is)", got, "fr")
+	}
+}
+
+func TestNegotiateLocaleMatchesExactTag(t *testing.T) {
+	withFixtureTranslations(t)
+	r := requestWithHeaders(t, map[string]string{"Accept-Language": "en-US;q=0.8"})
+
+	if got := NegotiateLocale(r); got != "en-us" {
+		t.Errorf("NegotiateLocale = %q, want %q", got, "en-us")
+	}
+}
+
+func TestNegotiateLocaleNeverReturnsEmptyString(t *testing.T) {
+	withFixtureTranslations(t)
+	previousLang := os.Getenv("CENOLANG")
+	os.Unsetenv("CENOLANG")
+	defer os.Setenv("CENOLANG", previousLang)
+
+	r := requestWithHeaders(t, map[string]string{"Accept-Language": "xx-XX,zz;q=0.5"})
+
+	if got := NegotiateLocale(r); got == "" {
+		t.Error("NegotiateLocale returned an empty string for an unsupported locale")
+	} else if got != "en-us" {
+		t.Errorf("NegotiateLocale = %q, want the default %q", got, "en-us")
+	}
+}
+
+func TestNegotiateLocaleFallsBackToCenolangEnvVar(t *testing.T) {
+	withFixtureTranslations(t)
+	previousLang := os.Getenv("CENOLANG")
+	os.Setenv("CENOLANG", "de-de")
+	defer os.Setenv("CENOLANG", previousLang)
+
+	r := requestWithHeaders(t, map[string]string{"Accept-Language": "xx-XX"})
+
+	if got := NegotiateLocale(r); got != "de-de" {
+		t.Errorf("NegotiateLocale = %q, want CENOLANG fallback %q", got, "de-de")
+	}
+}
+
+func TestMatchLocaleIsCaseInsensitive(t *testing.T) {
+	supported := []string{"en-us", "fr"}
+	if got := matchLocale("EN-US", supported); got != "en-us" {
+		t.Errorf("matchLocale(%q) = %q, want %q", "EN-US", got, "en-us")
+	}
+	if got := matchLocale("es", supported); got != "" {
+		t.Errorf("matchLocale(%q) = %q, want empty string", "es", got)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// RecoveryStatus describes the current state of a background recovery job
+// for a given ErrorCode.
+type RecoveryStatus int
+
+const (
+	RecoveryPending RecoveryStatus = iota
+	RecoveryInProgress
+	RecoverySucceeded
+	RecoveryFailed
+)
+
+// recoveryJob is a unit of work handed to the RecoveryManager: go fetch
+// whatever asset is missing for errCode and put it where it belongs.
+type recoveryJob struct {
+	errCode ErrorCode
+}
+
+// Where to download a recovered asset from, and where on disk to put it.
+// These are read from the environment so operators can point a CC instance
+// at whatever source serves known-good copies of these files, the same way
+// CENOLANG configures the error page locale.
+var recoverySources = map[ErrorCode]string{
+	ERR_NO_CONFIG:        os.Getenv("CENO_CONFIG_URL"),
+	ERR_NO_FEEDS_FILE:    os.Getenv("CENO_FEEDS_URL"),
+	ERR_NO_ARTICLES_FILE: os.Getenv("CENO_ARTICLES_URL"),
+	ERR_MISSING_VIEW:     os.Getenv("CENO_VIEWS_URL"),
+}
+
+var recoveryDestinations = map[ErrorCode]string{
+	ERR_NO_CONFIG:        ccConfigPath,
+	ERR_NO_FEEDS_FILE:    path.Join(".", "feeds", "feeds.json"),
+	ERR_NO_ARTICLES_FILE: path.Join(".", "feeds", "articles.json"),
+	ERR_MISSING_VIEW:     path.Join(".", "views"),
+}
+
+// recoveryArchiveTargets marks the ErrorCodes whose recovered asset is a zip
+// archive that must be unpacked into recoveryDestinations[errCode] (a
+// directory) rather than written as-is to a single file. ERR_MISSING_VIEW's
+// source serves the whole views/ bundle as one package (see
+// errorAdvice[ERR_MISSING_VIEW] == "download_package_err"), so recovering
+// from it means extracting that package, not saving it unopened.
+var recoveryArchiveTargets = map[ErrorCode]bool{
+	ERR_MISSING_VIEW: true,
+}
+
+// RecoveryManager runs as a single background goroutine that downloads
+// assets missing from disk on behalf of the error handlers, deduplicating
+// concurrent requests for the same ErrorCode into a single download.
+type RecoveryManager struct {
+	jobs         chan recoveryJob
+	client       *http.Client
+	mu           sync.Mutex
+	pending      map[ErrorCode]bool
+	statuses     map[ErrorCode]RecoveryStatus
+	sources      map[ErrorCode]string
+	destinations map[ErrorCode]string
+	archives     map[ErrorCode]bool
+}
+
+// NewRecoveryManager creates a RecoveryManager backed by the given source,
+// destination, and archive tables and starts its background worker
+// goroutine. The tables are taken as parameters, rather than read directly
+// off package globals, so tests can point recovery at a fake HTTP backend
+// and a scratch directory. archives may be nil for callers that never
+// recover an archived asset.
+func NewRecoveryManager(sources, destinations map[ErrorCode]string, archives map[ErrorCode]bool) *RecoveryManager {
+	rm := &RecoveryManager{
+		jobs:         make(chan recoveryJob, 32),
+		client:       &http.Client{},
+		pending:      make(map[ErrorCode]bool),
+		statuses:     make(map[ErrorCode]RecoveryStatus),
+		sources:      sources,
+		destinations: destinations,
+		archives:     archives,
+	}
+	go rm.run()
+	return rm
+}
+
+// Enqueue schedules a recovery job for errCode. If a job for this error
+// code is already pending or in progress, the call is a no-op so that,
+// e.g., ten concurrent ERR_NO_FEEDS_FILE hits schedule one download. It's
+// also a no-op once errCode has already recovered successfully, so an
+// auto-refreshing error page that keeps hitting the same handler (because
+// its recovery hasn't actually resolved the underlying problem yet) doesn't
+// re-trigger the download forever. The channel send happens outside the
+// lock so that a full job queue blocks only the calling goroutine, not
+// Status() or other Enqueue() calls.
+func (rm *RecoveryManager) Enqueue(errCode ErrorCode) {
+	rm.mu.Lock()
+	if rm.pending[errCode] || rm.statuses[errCode] == RecoverySucceeded {
+		rm.mu.Unlock()
+		return
+	}
+	rm.pending[errCode] = true
+	rm.statuses[errCode] = RecoveryPending
+	rm.mu.Unlock()
+	rm.jobs <- recoveryJob{errCode: errCode}
+}
+
+// Status reports the last known RecoveryStatus for errCode.
+func (rm *RecoveryManager) Status(errCode ErrorCode) RecoveryStatus {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return rm.statuses[errCode]
+}
+
+func (rm *RecoveryManager) run() {
+	for job := range rm.jobs {
+		rm.process(job)
+	}
+}
+
+func (rm *RecoveryManager) process(job recoveryJob) {
+	rm.mu.Lock()
+	rm.statuses[job.errCode] = RecoveryInProgress
+	rm.mu.Unlock()
+
+	err := rm.recover(job.errCode)
+
+	rm.mu.Lock()
+	delete(rm.pending, job.errCode)
+	if err != nil {
+		rm.statuses[job.errCode] = RecoveryFailed
+	} else {
+		rm.statuses[job.errCode] = RecoverySucceeded
+	}
+	rm.mu.Unlock()
+}
+
+// recover downloads the asset configured for errCode and atomically
+// installs it at its configured destination. If errCode is one of
+// recoveryArchiveTargets, the download is treated as a zip archive and
+// unpacked into the destination directory instead of written as one file.
+func (rm *RecoveryManager) recover(errCode ErrorCode) error {
+	sourceURL, hasSource := rm.sources[errCode]
+	destPath, hasDest := rm.destinations[errCode]
+	if !hasSource || !hasDest || sourceURL == "" {
+		return fmt.Errorf("no recovery source configured for error code %d", errCode)
+	}
+	response, err := rm.client.Get(sourceURL)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("recovery download for error code %d returned status %d", errCode, response.StatusCode)
+	}
+	if rm.archives[errCode] {
+		return extractZipArchive(destPath, response.Body)
+	}
+	return writeFileAtomically(destPath, response.Body)
+}
+
+// extractZipArchive unpacks the zip archive read from src and swaps it in to
+// replace destDir wholesale, so a file dropped from the bundle since the
+// last recovery doesn't linger on disk, and a reader never sees a partially
+// extracted directory. zip.NewReader needs random access to the archive's
+// central directory, so src is buffered to a temp file first rather than
+// held in memory. Fails if the archive didn't actually contain anything to
+// extract, since that almost certainly means recovery didn't fix what it
+// claims to.
+func extractZipArchive(destDir string, src io.Reader) error {
+	tmp, err := ioutil.TempFile("", ".recovery-archive-")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	size, copyErr := io.Copy(tmp, src)
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	archiveFile, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer archiveFile.Close()
+	reader, err := zip.NewReader(archiveFile, size)
+	if err != nil {
+		return err
+	}
+
+	stagingDir, err := ioutil.TempDir(filepath.Dir(destDir), ".recovery-staging-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	extracted := 0
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		destPath := filepath.Join(stagingDir, filepath.Clean(file.Name))
+		if !strings.HasPrefix(destPath, filepath.Clean(stagingDir)+string(os.PathSeparator)) {
+			return fmt.Errorf("zip entry %q escapes destination directory %q", file.Name, destDir)
+		}
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return err
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFileAtomically(destPath, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		extracted++
+	}
+	if extracted == 0 {
+		return fmt.Errorf("archive for destination %q contained no files to extract", destDir)
+	}
+
+	os.RemoveAll(destDir)
+	return os.Rename(stagingDir, destDir)
+}
+
+// writeFileAtomically downloads into a temp file beside destPath and renames
+// it into place, so a reader never sees a partially written asset.
+func writeFileAtomically(destPath string, src io.Reader) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(destPath), ".recovery-")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, copyErr := io.Copy(tmp, src)
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		os.Remove(tmpPath)
+		return copyErr
+	}
+	if closeErr != nil {
+		os.Remove(tmpPath)
+		return closeErr
+	}
+	return os.Rename(tmpPath, destPath)
+}
+
+// defaultRecoveryManager is the single RecoveryManager shared by all of the
+// CC's error handlers.
+var defaultRecoveryManager = NewRecoveryManager(recoverySources, recoveryDestinations, recoveryArchiveTargets)
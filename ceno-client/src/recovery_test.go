@@ -0,0 +1,216 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForStatus polls rm.Status(code) until it reaches a terminal state or
+// timeout elapses, failing the test in the latter case.
+func waitForStatus(t *testing.T, rm *RecoveryManager, code ErrorCode, timeout time.Duration) RecoveryStatus {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		switch status := rm.Status(code); status {
+		case RecoverySucceeded, RecoveryFailed:
+			return status
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for recovery of error code %d to finish", code)
+	return RecoveryFailed
+}
+
+func TestRecoveryManagerDedupesConcurrentEnqueues(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("feeds"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "recovery-dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rm := NewRecoveryManager(
+		map[ErrorCode]string{ERR_NO_FEEDS_FILE: server.URL},
+		map[ErrorCode]string{ERR_NO_FEEDS_FILE: filepath.Join(dir, "feeds.json")},
+		nil,
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rm.Enqueue(ERR_NO_FEEDS_FILE)
+		}()
+	}
+	wg.Wait()
+
+	if status := waitForStatus(t, rm, ERR_NO_FEEDS_FILE, 2*time.Second); status != RecoverySucceeded {
+		t.Fatalf("expected recovery to succeed, got status %v", status)
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected exactly one GET from ten concurrent Enqueue calls, got %d", got)
+	}
+}
+
+func TestRecoveryManagerMarksFailedOnNon200(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "recovery-fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rm := NewRecoveryManager(
+		map[ErrorCode]string{ERR_NO_CONFIG: server.URL},
+		map[ErrorCode]string{ERR_NO_CONFIG: filepath.Join(dir, "configuration.json")},
+		nil,
+	)
+	rm.Enqueue(ERR_NO_CONFIG)
+
+	if status := waitForStatus(t, rm, ERR_NO_CONFIG, 2*time.Second); status != RecoveryFailed {
+		t.Fatalf("expected recovery to fail for a non-200 response, got status %v", status)
+	}
+}
+
+func TestRecoveryManagerExtractsArchiveForArchiveTargets(t *testing.T) {
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+	f, err := zw.Create("missing.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("<html>recovered</html>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive.Bytes())
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "recovery-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	destDir := filepath.Join(dir, "views")
+
+	rm := NewRecoveryManager(
+		map[ErrorCode]string{ERR_MISSING_VIEW: server.URL},
+		map[ErrorCode]string{ERR_MISSING_VIEW: destDir},
+		map[ErrorCode]bool{ERR_MISSING_VIEW: true},
+	)
+	rm.Enqueue(ERR_MISSING_VIEW)
+
+	if status := waitForStatus(t, rm, ERR_MISSING_VIEW, 2*time.Second); status != RecoverySucceeded {
+		t.Fatalf("expected archive extraction to succeed, got status %v", status)
+	}
+	extracted, err := ioutil.ReadFile(filepath.Join(destDir, "missing.html"))
+	if err != nil {
+		t.Fatalf("expected missing.html to have been extracted: %v", err)
+	}
+	if string(extracted) != "<html>recovered</html>" {
+		t.Errorf("extracted file contents = %q, want %q", extracted, "<html>recovered</html>")
+	}
+}
+
+func TestRecoveryManagerEnqueueIsNoOpOnceSucceeded(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("feeds"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "recovery-no-reenqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rm := NewRecoveryManager(
+		map[ErrorCode]string{ERR_NO_FEEDS_FILE: server.URL},
+		map[ErrorCode]string{ERR_NO_FEEDS_FILE: filepath.Join(dir, "feeds.json")},
+		nil,
+	)
+	rm.Enqueue(ERR_NO_FEEDS_FILE)
+	waitForStatus(t, rm, ERR_NO_FEEDS_FILE, 2*time.Second)
+
+	rm.Enqueue(ERR_NO_FEEDS_FILE)
+	rm.Enqueue(ERR_NO_FEEDS_FILE)
+	time.Sleep(20 * time.Millisecond)
+
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("expected Enqueue to stay a no-op once recovery succeeded, got %d downloads", got)
+	}
+}
+
+// erroringReader always fails, simulating a filesystem/network read error
+// partway through a download.
+type erroringReader struct{}
+
+func (erroringReader) Read(p []byte) (int, error) {
+	return 0, errors.New("simulated read failure")
+}
+
+func TestWriteFileAtomicallyCleansUpOnCopyFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recovery-copy-failure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	destPath := filepath.Join(dir, "asset.txt")
+
+	if err := writeFileAtomically(destPath, erroringReader{}); err == nil {
+		t.Fatal("expected an error from a failing reader")
+	}
+	if _, err := os.Stat(destPath); !os.IsNotExist(err) {
+		t.Fatalf("destination file should not exist after a failed copy, stat returned: %v", err)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no leftover temp files, found %v", entries)
+	}
+}
+
+func TestWriteFileAtomicallyFailsForMissingDestinationDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recovery-missing-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	destPath := filepath.Join(dir, "does-not-exist", "asset.txt")
+
+	if err := writeFileAtomically(destPath, strings.NewReader("data")); err == nil {
+		t.Fatal("expected an error when the destination directory doesn't exist")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Tuning for the HTTP reporter's retry behaviour.
+const (
+	initialReportBackoff = 500 * time.Millisecond
+	maxReportBackoff     = 30 * time.Second
+	maxReportAttempts    = 6
+	reportQueueSize      = 256
+)
+
+// ReportEvent is the structured record pushed to a Reporter every time
+// HandleCCError or HandleLCSError handles an error.
+type ReportEvent struct {
+	Timestamp     time.Time `json:"timestamp"`
+	ErrorCode     ErrorCode `json:"errorCode"`
+	Message       string    `json:"message"`
+	RequestURL    string    `json:"requestUrl"`
+	CorrelationID string    `json:"correlationId"`
+}
+
+// Reporter is anything that can record a ReportEvent somewhere for
+// operators to look at later.
+type Reporter interface {
+	Report(event ReportEvent)
+}
+
+// noopReporter discards every event. Used when telemetry is disabled.
+type noopReporter struct{}
+
+func (noopReporter) Report(event ReportEvent) {}
+
+// fileReporter appends each event as a line of JSON to a local log file.
+type fileReporter struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileReporter creates a Reporter that appends JSON-lines to the file at path.
+func NewFileReporter(path string) *fileReporter {
+	return &fileReporter{path: path}
+}
+
+func (fr *fileReporter) Report(event ReportEvent) {
+	marshalled, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	f, err := os.OpenFile(fr.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(marshalled, '\n'))
+}
+
+// httpReporter POSTs each event to a remote collector. Reporting runs on a
+// background goroutine reading from a bounded queue so that a slow or down
+// collector never blocks error handling on the request path. Failed
+// deliveries are retried with exponential backoff and jitter.
+type httpReporter struct {
+	url    string
+	client *http.Client
+	queue  chan ReportEvent
+}
+
+// NewHTTPReporter creates a Reporter that posts events to url and starts its
+// background delivery goroutine.
+func NewHTTPReporter(url string) *httpReporter {
+	hr := &httpReporter{
+		url:    url,
+		client: &http.Client{},
+		queue:  make(chan ReportEvent, reportQueueSize),
+	}
+	go hr.run()
+	return hr
+}
+
+func (hr *httpReporter) Report(event ReportEvent) {
+	select {
+	case hr.queue <- event:
+	default:
+		// The queue is full; drop the event rather than block the caller.
+	}
+}
+
+func (hr *httpReporter) run() {
+	for event := range hr.queue {
+		hr.send(event)
+	}
+}
+
+func (hr *httpReporter) send(event ReportEvent) {
+	marshalled, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	delay := initialReportBackoff
+	for attempt := 0; attempt < maxReportAttempts; attempt++ {
+		if hr.post(marshalled) {
+			return
+		}
+		if attempt == maxReportAttempts-1 {
+			return
+		}
+		time.Sleep(delay + jitter(delay))
+		delay *= 2
+		if delay > maxReportBackoff {
+			delay = maxReportBackoff
+		}
+	}
+}
+
+func (hr *httpReporter) post(body []byte) bool {
+	req, err := http.NewRequest("POST", hr.url, bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	response, err := hr.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer response.Body.Close()
+	return response.StatusCode == http.StatusOK
+}
+
+// jitter returns a random duration in [0, d) to avoid synchronized retries
+// from many CC instances hammering a collector at the same moment.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(d)))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(n.Int64())
+}
+
+// newCorrelationID generates a short id to tie together everything reported
+// about a single request.
+func newCorrelationID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// NewReporterFromConfig builds the Reporter configured in the CC's config
+// file's "reporter" section ({"backend": "http"|"file"|"none", "url": ...,
+// "logPath": ...}), so operators can disable telemetry entirely or point it
+// at a log file without touching the process environment. Any problem
+// reading or parsing the config, an unrecognized backend, or a backend
+// that's missing the setting it needs, all fall back to a no-op reporter
+// rather than risk silently hammering an empty URL.
+func NewReporterFromConfig() Reporter {
+	config, err := loadCCConfig()
+	if err != nil {
+		return noopReporter{}
+	}
+	switch config.Reporter.Backend {
+	case "file":
+		if config.Reporter.LogPath == "" {
+			return noopReporter{}
+		}
+		return NewFileReporter(config.Reporter.LogPath)
+	case "http":
+		if config.Reporter.URL == "" {
+			return noopReporter{}
+		}
+		return NewHTTPReporter(config.Reporter.URL)
+	default:
+		return noopReporter{}
+	}
+}
+
+// defaultReporter is the Reporter shared by all of the CC's error handling.
+var defaultReporter = NewReporterFromConfig()